@@ -139,6 +139,35 @@ func BenchmarkHllPlus16(b *testing.B) {
 	benchmarkPlus(16, b)
 }
 
+func BenchmarkHllPlusBytes(b *testing.B) {
+	b.StopTimer()
+	keys := make([][]byte, 8192)
+	for i := range keys {
+		key := make([]byte, 8)
+		rand.Read(key)
+		keys[i] = key
+	}
+	h, _ := NewPlus(14)
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		h.AddBytes(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkConcurrentPlusAddN(b *testing.B) {
+	c, _ := NewConcurrentPlus(14)
+
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		key := make([]byte, 8)
+		for pb.Next() {
+			rnd.Read(key)
+			c.AddBytes(key)
+		}
+	})
+}
+
 func BenchmarkHLLSparseAdd(b *testing.B) {
 	hashes := hashMaker{b: b}
 	for n := 0; n < b.N; n++ {
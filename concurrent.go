@@ -0,0 +1,167 @@
+package hyperloglog
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// ConcurrentPlus is a concurrent-safe HyperLogLogPlus, sharded into N
+// independently-locked HyperLogLogPlus sketches so concurrent Add calls
+// usually only contend within a single shard rather than one global mutex.
+type ConcurrentPlus struct {
+	precision uint8
+	hasher    func([]byte) uint64
+	mask      uint32
+	shards    []*concurrentShard
+}
+
+type concurrentShard struct {
+	mu sync.Mutex
+	h  *HyperLogLogPlus
+}
+
+// NewConcurrentPlus returns a new ConcurrentPlus with
+// runtime.GOMAXPROCS(0) shards, rounded up to the next power of two, each a
+// HyperLogLogPlus at the given precision.
+func NewConcurrentPlus(precision uint8) (*ConcurrentPlus, error) {
+	return newConcurrentPlus(precision, nextPowerOfTwo(runtime.GOMAXPROCS(0)), defaultHasher)
+}
+
+// NewConcurrentPlusWithHasher returns a new ConcurrentPlus whose AddBytes
+// hashes raw bytes with hasher instead of the built-in default, mirroring
+// NewPlusWithHasher for the sharded wrapper.
+func NewConcurrentPlusWithHasher(precision uint8, hasher func([]byte) uint64) (*ConcurrentPlus, error) {
+	return newConcurrentPlus(precision, nextPowerOfTwo(runtime.GOMAXPROCS(0)), hasher)
+}
+
+func newConcurrentPlus(precision uint8, n int, hasher func([]byte) uint64) (*ConcurrentPlus, error) {
+	shards := make([]*concurrentShard, n)
+	for i := range shards {
+		h, err := createPlus(precision)
+		if err != nil {
+			return nil, err
+		}
+		h.hasher = hasher
+		h.Clear()
+		shards[i] = &concurrentShard{h: h}
+	}
+
+	return &ConcurrentPlus{
+		precision: precision,
+		hasher:    hasher,
+		mask:      uint32(n - 1),
+		shards:    shards,
+	}, nil
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// Add adds a new item to c.
+func (c *ConcurrentPlus) Add(item Hash64) {
+	c.addHash(item.Sum64())
+}
+
+// AddBytes hashes b with c's hasher and adds the result to c.
+func (c *ConcurrentPlus) AddBytes(b []byte) {
+	c.addHash(c.hasher(b))
+}
+
+// addHash routes x to a shard by a hash-of-hash, independent of the bits
+// HyperLogLogPlus itself uses for the register index, and adds it under
+// that shard's lock.
+func (c *ConcurrentPlus) addHash(x uint64) {
+	shard := c.shards[c.shardFor(x)]
+	shard.mu.Lock()
+	shard.h.addHash64(x)
+	shard.mu.Unlock()
+}
+
+func (c *ConcurrentPlus) shardFor(x uint64) uint32 {
+	return uint32((x*0x9E3779B97F4A7C15)>>32) & c.mask
+}
+
+// Count returns the cardinality estimate across all shards.
+func (c *ConcurrentPlus) Count() uint64 {
+	return c.snapshot().Count()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler by merging all shards
+// into a snapshot sketch and marshaling that.
+func (c *ConcurrentPlus) MarshalBinary() ([]byte, error) {
+	return c.snapshot().MarshalBinary()
+}
+
+// snapshot merges all shards into a single HyperLogLogPlus, locking each
+// shard only long enough to merge it.
+func (c *ConcurrentPlus) snapshot() *HyperLogLogPlus {
+	merged, _ := createPlus(c.precision)
+	merged.Clear()
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		merged.Merge(shard.h)
+		shard.mu.Unlock()
+	}
+	return merged
+}
+
+// Merge merges other into c, shard-wise and in parallel. Both sketches must
+// have the same precision and the same number of shards.
+//
+// Each goroutine below only ever holds one shard's lock at a time -- it
+// snapshots other's shard under other's lock, releases it, then locks c's
+// shard to merge the snapshot in. Holding both locks at once (in c, other
+// order) would deadlock against a concurrent other.Merge(c), which takes
+// them in the opposite order.
+func (c *ConcurrentPlus) Merge(other *ConcurrentPlus) error {
+	if c.precision != other.precision {
+		return errors.New("precisions must be equal")
+	}
+	if len(c.shards) != len(other.shards) {
+		return errors.New("shard counts must be equal")
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(c.shards))
+	for i := range c.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cs, os := c.shards[i], other.shards[i]
+
+			os.mu.Lock()
+			snapshot := os.h.Clone()
+			os.mu.Unlock()
+
+			cs.mu.Lock()
+			errs[i] = cs.h.Merge(snapshot)
+			cs.mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush collapses all shards back into a single HyperLogLogPlus and clears
+// c back to its initial, empty state.
+func (c *ConcurrentPlus) Flush() *HyperLogLogPlus {
+	merged := c.snapshot()
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		shard.h.Clear()
+		shard.mu.Unlock()
+	}
+	return merged
+}
@@ -0,0 +1,52 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestDefaultHasherDistributesSequentialKeys guards against regressing to
+// a hasher with no avalanche/finalization step (e.g. bare FNV-1a), which
+// badly correlates the high bits -- the ones encodeHash uses for the
+// register index -- for inputs that only differ in a numeric suffix. It
+// checks the register index bits directly rather than going through
+// Count(), so it catches the exact failure mode that mattered in
+// practice: crypto/rand-derived test keys don't expose it, sequential or
+// shared-prefix keys do.
+func TestDefaultHasherDistributesSequentialKeys(t *testing.T) {
+	const n = 14311
+	const p = 14
+	seen := make(map[uint64]bool, n)
+	for i := 0; i < n; i++ {
+		x := defaultHasher([]byte(fmt.Sprintf("x-%d", i)))
+		seen[x>>(64-p)] = true
+	}
+
+	// A uniform hash collects close to n distinct p-bit indices out of 2^p
+	// = 16384 buckets; a hasher with no avalanche step collapses these
+	// particular sequential keys to a small fraction of that.
+	if want := n / 2; len(seen) < want {
+		t.Errorf("defaultHasher on sequential keys produced %d distinct %d-bit indices out of %d, want >= %d", len(seen), p, n, want)
+	}
+}
+
+// TestAddBytesSequentialKeysEstimateAccuracy is an end-to-end version of
+// the same regression: Count() must stay within the usual HLL error bound
+// when fed AddBytes over sequential, shared-prefix keys, not just the
+// crypto/rand-derived keys that happen to hide a badly correlated hasher.
+func TestAddBytesSequentialKeysEstimateAccuracy(t *testing.T) {
+	const p = uint8(10)
+	const n = 40000
+
+	h, _ := NewPlus(p)
+	for i := 0; i < n; i++ {
+		h.AddBytes([]byte(fmt.Sprintf("x-%d", i)))
+	}
+
+	got := float64(h.Count())
+	tol := 6 * hllStdErr(p) * n
+	if diff := math.Abs(got - n); diff > tol {
+		t.Errorf("Count() on sequential keys = %v, want %v +/- %v", got, float64(n), tol)
+	}
+}
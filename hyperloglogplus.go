@@ -6,6 +6,8 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"sort"
 
 	bits "github.com/dgryski/go-bits"
 )
@@ -19,11 +21,194 @@ var threshold = []uint{
 }
 
 type HyperLogLogPlus struct {
-	reg       []uint8
-	p         uint8
-	m         uint32
-	sparse    bool
-	sparseSet compactSet
+	reg        []uint8
+	overflow   map[uint32]uint8 // registers >15 in RegisterPacked4 mode
+	mode       RegisterMode
+	p          uint8
+	m          uint32
+	sparse     bool
+	sparseList sparseList
+	tmpSet     []uint32
+	hasher     func([]byte) uint64
+}
+
+// RegisterMode selects how dense registers are packed in memory and on the
+// wire. The zero value, RegisterDense, is the historical one-byte-per-
+// register layout; the packed modes trade a little CPU for a smaller
+// footprint.
+type RegisterMode uint8
+
+const (
+	// RegisterDense stores one byte per register.
+	RegisterDense RegisterMode = iota
+	// RegisterPacked6 packs each register into 6 bits, the minimum needed
+	// to hold any HyperLogLog++ register value exactly.
+	RegisterPacked6
+	// RegisterPacked4 packs each register into 4 bits. Registers that
+	// don't fit (values above 15, rare at p<=14 for realistic
+	// cardinalities) are recorded in the overflow side-table instead.
+	RegisterPacked4
+)
+
+const regOverflow4 = 0xf
+
+// regSize returns the number of bytes needed to store m registers in mode,
+// padded by one extra byte so getReg/setRegMax can always read a 16-bit
+// window around the bit offset they target.
+func regSize(m uint32, mode RegisterMode) int {
+	switch mode {
+	case RegisterPacked6:
+		return int((uint64(m)*6+7)/8) + 1
+	case RegisterPacked4:
+		return int((uint64(m)+1)/2) + 1
+	default:
+		return int(m)
+	}
+}
+
+// getBits reads an n-bit (n<=8) field starting at the given bit offset.
+func getBits(buf []byte, offset uint64, n uint) uint8 {
+	byteIdx := offset / 8
+	bitIdx := offset % 8
+	v := uint16(buf[byteIdx]) | uint16(buf[byteIdx+1])<<8
+	return uint8((v >> bitIdx) & (1<<n - 1))
+}
+
+// setBits writes an n-bit (n<=8) field starting at the given bit offset.
+func setBits(buf []byte, offset uint64, n uint, val uint8) {
+	byteIdx := offset / 8
+	bitIdx := offset % 8
+	mask := uint16(1<<n-1) << bitIdx
+	v := uint16(buf[byteIdx]) | uint16(buf[byteIdx+1])<<8
+	v = v&^mask | uint16(val)<<bitIdx&mask
+	buf[byteIdx] = byte(v)
+	buf[byteIdx+1] = byte(v >> 8)
+}
+
+// getReg returns the current value of register i, regardless of storage mode.
+func (h *HyperLogLogPlus) getReg(i uint32) uint8 {
+	switch h.mode {
+	case RegisterPacked6:
+		return getBits(h.reg, uint64(i)*6, 6)
+	case RegisterPacked4:
+		v := getBits(h.reg, uint64(i)*4, 4)
+		if v == regOverflow4 {
+			if ov, ok := h.overflow[i]; ok {
+				return ov
+			}
+		}
+		return v
+	default:
+		return h.reg[i]
+	}
+}
+
+// setRegMax sets register i to v if v is larger than its current value,
+// regardless of storage mode.
+func (h *HyperLogLogPlus) setRegMax(i uint32, v uint8) {
+	if h.getReg(i) >= v {
+		return
+	}
+	switch h.mode {
+	case RegisterPacked6:
+		setBits(h.reg, uint64(i)*6, 6, v)
+	case RegisterPacked4:
+		if v >= regOverflow4 {
+			if h.overflow == nil {
+				h.overflow = make(map[uint32]uint8)
+			}
+			h.overflow[i] = v
+			setBits(h.reg, uint64(i)*4, 4, regOverflow4)
+			return
+		}
+		setBits(h.reg, uint64(i)*4, 4, v)
+	default:
+		h.reg[i] = v
+	}
+}
+
+// regSnapshot materializes the dense registers as one byte each, for use by
+// the estimation math in countZeros/calculateEstimate, which is unchanged
+// by packed storage.
+func (h *HyperLogLogPlus) regSnapshot() []uint8 {
+	if h.mode == RegisterDense {
+		return h.reg
+	}
+	snap := make([]uint8, h.m)
+	for i := uint32(0); i < h.m; i++ {
+		snap[i] = h.getReg(i)
+	}
+	return snap
+}
+
+// sparseList is the persistent sparse representation described by the
+// HyperLogLog++ paper: a sorted list of encodeHash codes, stored as the
+// varint-encoded delta from the previous entry so that runs of nearby
+// indices cost 1-2 bytes instead of a full 4-byte uint32.
+type sparseList []byte
+
+// sparseListIterator walks a sparseList, decoding one difference-encoded
+// entry at a time.
+type sparseListIterator struct {
+	data []byte
+	last uint32
+}
+
+func (l sparseList) iterator() *sparseListIterator {
+	return &sparseListIterator{data: l}
+}
+
+// next returns the next encoded hash in l, or ok == false once exhausted.
+func (it *sparseListIterator) next() (k uint32, ok bool) {
+	if len(it.data) == 0 {
+		return 0, false
+	}
+	delta, n := binary.Uvarint(it.data)
+	it.data = it.data[n:]
+	it.last += uint32(delta)
+	return it.last, true
+}
+
+// count returns the number of entries encoded in l.
+func (l sparseList) count() int {
+	n := 0
+	for it := l.iterator(); ; n++ {
+		if _, ok := it.next(); !ok {
+			return n
+		}
+	}
+}
+
+// appendSparse appends k to list as the varint-encoded delta from prev, and
+// returns the updated list along with the new prev.
+func appendSparse(list sparseList, prev, k uint32) (sparseList, uint32) {
+	var buf [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(buf[:], uint64(k-prev))
+	return append(list, buf[:n]...), k
+}
+
+// defaultHasher is the non-cryptographic hash used by AddBytes when a
+// HyperLogLogPlus is created without an explicit hasher. FNV-1a has no
+// finalization step of its own and badly correlates the high bits --
+// exactly the bits encodeHash uses for the register index -- for inputs
+// that share a prefix, such as sequential IDs. Running its output through
+// splitMix64Finalize's avalanche mix fixes that without pulling in an
+// external dependency. Callers who need more speed (e.g. AMD64-optimized
+// xxhash) can supply their own via NewPlusWithHasher.
+func defaultHasher(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return splitMix64Finalize(h.Sum64())
+}
+
+// splitMix64Finalize is SplitMix64's output mixing function: a 3-round
+// xorshift-multiply avalanche finisher in which flipping any input bit
+// flips roughly half the output bits.
+func splitMix64Finalize(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
 }
 
 // Encode a hash to be used in the sparse representation.
@@ -45,6 +230,15 @@ func (h *HyperLogLogPlus) getIndex(k uint32) uint32 {
 	return eb32(k, pPrime+1, pPrime-h.p+1)
 }
 
+// sparseKey returns k's full p'-bit index, the resolution the persistent
+// sparse list stays deduped at, as opposed to getIndex's coarser p-bit index.
+func sparseKey(k uint32) uint32 {
+	if k&1 == 1 {
+		return k >> 7
+	}
+	return k >> 1
+}
+
 // Decode a hash from the sparse representation.
 func (h *HyperLogLogPlus) decodeHash(k uint32) (uint32, uint8) {
 	var r uint8
@@ -77,14 +271,46 @@ func createPlus(precision uint8) (*HyperLogLogPlus, error) {
 	h := &HyperLogLogPlus{}
 	h.p = precision
 	h.m = 1 << precision
+	h.hasher = defaultHasher
+	return h, nil
+}
+
+// NewPlusWithHasher returns a new initialized HyperLogLogPlus whose AddBytes
+// method hashes raw bytes with hasher instead of the built-in default. This
+// lets callers drop in a faster non-cryptographic hash (e.g. xxhash or
+// murmur3) for large-scale ingest without boxing each item into a
+// hash.Hash64.
+func NewPlusWithHasher(precision uint8, hasher func([]byte) uint64) (*HyperLogLogPlus, error) {
+	h, err := createPlus(precision)
+	if err != nil {
+		return nil, err
+	}
+	h.hasher = hasher
+	h.Clear()
+	return h, nil
+}
+
+// NewPlusPacked returns a new initialized HyperLogLogPlus whose dense
+// representation packs registers according to mode instead of using one
+// byte each, shrinking both memory and serialized size once the sketch
+// converts out of the sparse representation.
+func NewPlusPacked(precision uint8, mode RegisterMode) (*HyperLogLogPlus, error) {
+	h, err := createPlus(precision)
+	if err != nil {
+		return nil, err
+	}
+	h.mode = mode
+	h.Clear()
 	return h, nil
 }
 
 // Clear sets HyperLogLogPlus h back to its initial state.
 func (h *HyperLogLogPlus) Clear() {
 	h.sparse = true
-	h.sparseSet = make(compactSet, 0, h.m/4)
+	h.sparseList = nil
+	h.tmpSet = make([]uint32, 0, h.maxTmpSet())
 	h.reg = nil
+	h.overflow = nil
 }
 
 func (h *HyperLogLogPlus) maxTmpSet() int {
@@ -94,36 +320,133 @@ func (h *HyperLogLogPlus) maxTmpSet() int {
 // Converts HyperLogLogPlus h to the normal representation from the sparse
 // representation.
 func (h *HyperLogLogPlus) toNormal() {
-	h.reg = make([]uint8, h.m)
-	for _, k := range h.sparseSet {
+	h.mergeSparse()
+
+	h.reg = make([]uint8, regSize(h.m, h.mode))
+	h.overflow = nil
+	it := h.sparseList.iterator()
+	for k, ok := it.next(); ok; k, ok = it.next() {
 		h.addHash(k)
 	}
 
 	h.sparse = false
-	h.sparseSet = nil
+	h.sparseList = nil
+	h.tmpSet = nil
+}
+
+// mergeSparse flushes tmpSet into the persistent sparseList: it sorts and
+// dedupes tmpSet (keeping the max rho for each index), then linearly merges
+// the resulting stream with sparseList, again keeping the max rho for any
+// index the two streams share.
+func (h *HyperLogLogPlus) mergeSparse() {
+	if len(h.tmpSet) == 0 {
+		return
+	}
+
+	h.sparseList = h.mergeSparseLists(h.sparseList, h.encodeSorted(h.tmpSet))
+	h.tmpSet = h.tmpSet[:0]
+}
+
+// encodeSorted sorts tmp by its full p'-bit sparseKey, dedupes it (keeping
+// the entry with the max rho for each key), and difference-encodes the
+// result into a sparseList. It sorts tmp in place.
+func (h *HyperLogLogPlus) encodeSorted(tmp []uint32) sparseList {
+	sort.Slice(tmp, func(i, j int) bool { return sparseKey(tmp[i]) < sparseKey(tmp[j]) })
+
+	var out sparseList
+	var prev uint32
+	for i := 0; i < len(tmp); {
+		best := tmp[i]
+		_, bestR := h.decodeHash(best)
+
+		j := i + 1
+		for j < len(tmp) && sparseKey(tmp[j]) == sparseKey(best) {
+			if _, r := h.decodeHash(tmp[j]); r > bestR {
+				best, bestR = tmp[j], r
+			}
+			j++
+		}
+
+		out, prev = appendSparse(out, prev, best)
+		i = j
+	}
+	return out
+}
+
+// mergeSparseLists linearly merges two sorted sparseLists into one, keeping
+// the entry with the max rho for any p'-bit sparseKey present in both.
+func (h *HyperLogLogPlus) mergeSparseLists(a, b sparseList) sparseList {
+	out := make(sparseList, 0, len(a)+len(b))
+	ai, bi := a.iterator(), b.iterator()
+	av, aok := ai.next()
+	bv, bok := bi.next()
+	var prev uint32
+
+	for aok || bok {
+		switch {
+		case !bok:
+			out, prev = appendSparse(out, prev, av)
+			av, aok = ai.next()
+		case !aok:
+			out, prev = appendSparse(out, prev, bv)
+			bv, bok = bi.next()
+		default:
+			aIdx, bIdx := sparseKey(av), sparseKey(bv)
+			switch {
+			case aIdx < bIdx:
+				out, prev = appendSparse(out, prev, av)
+				av, aok = ai.next()
+			case bIdx < aIdx:
+				out, prev = appendSparse(out, prev, bv)
+				bv, bok = bi.next()
+			default:
+				_, ar := h.decodeHash(av)
+				_, br := h.decodeHash(bv)
+				if br > ar {
+					av = bv
+				}
+				out, prev = appendSparse(out, prev, av)
+				av, aok = ai.next()
+				bv, bok = bi.next()
+			}
+		}
+	}
+	return out
 }
 
 func (h *HyperLogLogPlus) addHash(k uint32) {
 	i, r := h.decodeHash(k)
-	if h.reg[i] < r {
-		h.reg[i] = r
-	}
+	h.setRegMax(i, r)
 }
 
 // Add adds a new item to HyperLogLogPlus h.
 func (h *HyperLogLogPlus) Add(item Hash64) {
-	x := item.Sum64()
+	h.addHash64(item.Sum64())
+}
+
+// AddBytes hashes b with h's configured hasher (the default, unless the
+// sketch was created with NewPlusWithHasher) and adds the result to
+// HyperLogLogPlus h. Unlike Add, it takes raw bytes directly, so callers
+// don't need to box each item into a hash.Hash64, which avoids the
+// allocation that boxing causes on the hot insert path.
+func (h *HyperLogLogPlus) AddBytes(b []byte) {
+	h.addHash64(h.hasher(b))
+}
+
+// addHash64 is the shared insert path used by both Add and AddBytes.
+func (h *HyperLogLogPlus) addHash64(x uint64) {
 	if h.sparse {
-		h.sparseSet.Add(h.encodeHash(x))
+		h.tmpSet = append(h.tmpSet, h.encodeHash(x))
+		if len(h.tmpSet) >= h.maxTmpSet() {
+			h.mergeSparse()
+		}
 		h.maybeToNormal()
 	} else {
-		i := eb64(x, 64, 64-h.p) // {x63,...,x64-p}
-		w := x<<h.p | 1<<(h.p-1) // {x63-p,...,x0}
+		i := uint32(eb64(x, 64, 64-h.p)) // {x63,...,x64-p}
+		w := x<<h.p | 1<<(h.p-1)         // {x63-p,...,x0}
 
 		zeroBits := uint8(bits.Clz(w)) + 1
-		if zeroBits > h.reg[i] {
-			h.reg[i] = zeroBits
-		}
+		h.setRegMax(i, zeroBits)
 	}
 }
 
@@ -134,20 +457,15 @@ func (h *HyperLogLogPlus) Merge(other *HyperLogLogPlus) error {
 	}
 
 	if h.sparse && other.sparse {
-		origSparse := h.sparseSet[:]
-		for _, k := range other.sparseSet {
-			if !h.sparse {
-				h.addHash(k)
-				continue
-			}
+		h.mergeSparse()
 
-			// Optimization: other.sparseSet is already de-duped, so only check
-			// for dupes against our original, local sparseSet
-			if !origSparse.Has(k) {
-				h.sparseSet = append(h.sparseSet, k)
-			}
-			h.maybeToNormal()
+		otherSparse := other.sparseList
+		if len(other.tmpSet) > 0 {
+			otherSparse = h.mergeSparseLists(other.sparseList, h.encodeSorted(append([]uint32(nil), other.tmpSet...)))
 		}
+
+		h.sparseList = h.mergeSparseLists(h.sparseList, otherSparse)
+		h.maybeToNormal()
 		return nil
 	}
 
@@ -156,22 +474,24 @@ func (h *HyperLogLogPlus) Merge(other *HyperLogLogPlus) error {
 	}
 
 	if other.sparse {
-		for _, k := range other.sparseSet {
+		it := other.sparseList.iterator()
+		for k, ok := it.next(); ok; k, ok = it.next() {
+			h.addHash(k)
+		}
+		for _, k := range other.tmpSet {
 			h.addHash(k)
 		}
 	} else {
-		for i, v := range other.reg {
-			if v > h.reg[i] {
-				h.reg[i] = v
-			}
+		for i := uint32(0); i < other.m; i++ {
+			h.setRegMax(i, other.getReg(i))
 		}
 	}
 	return nil
 }
 
-// Converts to normal if the sparse list is too large.
+// Converts to normal if the sparse representation has grown too large.
 func (h *HyperLogLogPlus) maybeToNormal() {
-	if uint32(len(h.sparseSet)) >= h.m/4 {
+	if uint32(len(h.sparseList)+len(h.tmpSet)*4) >= h.m {
 		h.toNormal()
 	}
 }
@@ -203,15 +523,18 @@ func (h *HyperLogLogPlus) estimateBias(est float64) float64 {
 // Count returns the cardinality estimate.
 func (h *HyperLogLogPlus) Count() uint64 {
 	if h.sparse {
-		return uint64(linearCounting(mPrime, mPrime-uint32(len(h.sparseSet))))
+		h.mergeSparse()
+		return uint64(linearCounting(mPrime, mPrime-uint32(h.sparseList.count())))
 	}
 
-	est := calculateEstimate(h.reg)
+	regs := h.regSnapshot()
+
+	est := calculateEstimate(regs)
 	if est <= float64(h.m)*5.0 {
 		est -= h.estimateBias(est)
 	}
 
-	if v := countZeros(h.reg); v != 0 {
+	if v := countZeros(regs); v != 0 {
 		lc := linearCounting(h.m, v)
 		if lc <= float64(threshold[h.p-4]) {
 			return uint64(lc)
@@ -222,6 +545,10 @@ func (h *HyperLogLogPlus) Count() uint64 {
 
 // Encode HyperLogLogPlus into a gob
 func (h *HyperLogLogPlus) GobEncode() ([]byte, error) {
+	if h.sparse {
+		h.mergeSparse()
+	}
+
 	buf := bytes.Buffer{}
 	enc := gob.NewEncoder(&buf)
 	if err := enc.Encode(h.reg); err != nil {
@@ -236,8 +563,15 @@ func (h *HyperLogLogPlus) GobEncode() ([]byte, error) {
 	if err := enc.Encode(h.sparse); err != nil {
 		return nil, err
 	}
+	if err := enc.Encode(h.mode); err != nil {
+		return nil, err
+	}
 	if h.sparse {
-		if err := enc.Encode(h.sparseSet); err != nil {
+		if err := enc.Encode([]byte(h.sparseList)); err != nil {
+			return nil, err
+		}
+	} else if h.mode == RegisterPacked4 {
+		if err := enc.Encode(h.overflow); err != nil {
 			return nil, err
 		}
 	}
@@ -259,49 +593,153 @@ func (h *HyperLogLogPlus) GobDecode(b []byte) error {
 	if err := dec.Decode(&h.sparse); err != nil {
 		return err
 	}
+	if err := dec.Decode(&h.mode); err != nil {
+		return err
+	}
+	h.hasher = defaultHasher
+	h.tmpSet = nil
+	h.overflow = nil
 	if h.sparse {
-		if err := dec.Decode(&h.sparseSet); err != nil {
+		var raw []byte
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		h.sparseList = sparseList(raw)
+	} else if h.mode == RegisterPacked4 {
+		if err := dec.Decode(&h.overflow); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-const binaryVersion = 1
+// legacyBinaryVersion 1 predates the flags byte: data[2] is a bare 0/1
+// sparse flag, the sparse payload is a flat sequence of big-endian uint32
+// encodeHash codes (4 bytes/entry, no varint deltas), and the dense payload
+// is one byte per register. Version 2 replaced data[2] with a flags byte
+// that also records the RegisterMode. Both are superseded by the streaming
+// codec in streaming.go, but UnmarshalBinary still decodes them for blobs
+// written by earlier versions of this package.
+const (
+	legacyBinaryVersion = 2
+
+	flagSparse    = 1 << 0
+	flagModeShift = 1
+	flagModeMask  = 0x3 << flagModeShift
+)
 
-// Encode to binary much faster (and less safely) than Gob can manage.
-// Implements the encoding.BinaryMarshaler interface.
-func (h *HyperLogLogPlus) MarshalBinary() ([]byte, error) {
-	size := 3
+// encodeFlags packs h.sparse and h.mode into the single flags byte shared
+// by the legacy binaryVersion 2 layout and the streaming codec.
+func (h *HyperLogLogPlus) encodeFlags() byte {
+	var flags byte
 	if h.sparse {
-		size += 4 * len(h.sparseSet)
-	} else {
-		size += len(h.reg)
+		flags |= flagSparse
 	}
+	flags |= byte(h.mode) << flagModeShift
+	return flags
+}
 
-	data := make([]byte, size)
-	data[0] = binaryVersion
-	data[1] = h.p
-
+// encodePayload returns h's sparse or dense register bytes -- plus, in
+// RegisterPacked4 mode, the overflow side-table -- the payload format
+// shared by the legacy binaryVersion 2 layout and the streaming codec.
+// h.mergeSparse must already have been called if h is sparse.
+func (h *HyperLogLogPlus) encodePayload() []byte {
 	if h.sparse {
-		data[2] = 1
-		for i, val := range h.sparseSet {
-			offset := 3 + (i * 4)
-			binary.BigEndian.PutUint32(data[offset:offset+4], val)
+		return append([]byte(nil), h.sparseList...)
+	}
+
+	overflowSize := 0
+	if h.mode == RegisterPacked4 {
+		overflowSize = 4 + 5*len(h.overflow)
+	}
+
+	payload := make([]byte, len(h.reg)+overflowSize)
+	offset := copy(payload, h.reg)
+	if h.mode == RegisterPacked4 {
+		binary.BigEndian.PutUint32(payload[offset:offset+4], uint32(len(h.overflow)))
+		offset += 4
+		for idx, v := range h.overflow {
+			binary.BigEndian.PutUint32(payload[offset:offset+4], idx)
+			payload[offset+4] = v
+			offset += 5
 		}
-		return data, nil
+	}
+	return payload
+}
+
+// decodePayload populates h's registers from a payload produced by
+// encodePayload. h.p and h.m must already be set.
+func (h *HyperLogLogPlus) decodePayload(flags byte, payload []byte) error {
+	h.sparse = flags&flagSparse != 0
+	h.mode = RegisterMode((flags & flagModeMask) >> flagModeShift)
+	h.overflow = nil
+
+	if h.sparse {
+		h.reg = nil
+		h.sparseList = append(sparseList(nil), payload...)
+		return nil
 	}
 
-	copy(data[3:], h.reg)
+	h.sparseList = nil
+	regBytes := regSize(h.m, h.mode)
+	if len(payload) < regBytes {
+		return fmt.Errorf("expected payload of at least size %d, got %d", regBytes, len(payload))
+	}
+	h.reg = make([]uint8, regBytes)
+	copy(h.reg, payload[:regBytes])
 
-	return data, nil
+	if h.mode == RegisterPacked4 {
+		offset := regBytes
+		if len(payload) < offset+4 {
+			return errors.New("truncated overflow table")
+		}
+		n := binary.BigEndian.Uint32(payload[offset : offset+4])
+		offset += 4
+		for i := uint32(0); i < n; i++ {
+			if len(payload) < offset+5 {
+				return errors.New("truncated overflow table")
+			}
+			if h.overflow == nil {
+				h.overflow = make(map[uint32]uint8, n)
+			}
+			h.overflow[binary.BigEndian.Uint32(payload[offset:offset+4])] = payload[offset+4]
+			offset += 5
+		}
+	}
+	return nil
 }
 
-// Decode binary created by MarshalBinary, above.
+// MarshalBinary implements encoding.BinaryMarshaler as a thin wrapper over
+// the WriteTo/ReadPlusFrom streaming codec.
+func (h *HyperLogLogPlus) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler as a thin wrapper
+// over ReadPlusFrom. It also still decodes the legacy (pre-streaming)
+// binaryVersion 1 and 2 layouts, so blobs already on disk from earlier
+// versions of this package keep working.
 // Can safely be called on an empty HyperLogLogPlus struct.
-// Implements the encoding.BinaryUnmarshaler interface.
 func (h *HyperLogLogPlus) UnmarshalBinary(data []byte) error {
-	if data[0] != binaryVersion {
+	if len(data) >= len(streamMagic) && bytes.Equal(data[:len(streamMagic)], streamMagic[:]) {
+		decoded, err := ReadPlusFrom(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		*h = *decoded
+		return nil
+	}
+	return h.unmarshalLegacyBinary(data)
+}
+
+// unmarshalLegacyBinary decodes the pre-streaming binaryVersion 1 and 2
+// layouts produced by MarshalBinary before the streaming codec existed.
+func (h *HyperLogLogPlus) unmarshalLegacyBinary(data []byte) error {
+	if data[0] != 1 && data[0] != legacyBinaryVersion {
 		return fmt.Errorf("cannot unmarshal unknown binary version %d", data[0])
 	}
 
@@ -310,29 +748,44 @@ func (h *HyperLogLogPlus) UnmarshalBinary(data []byte) error {
 	}
 	h.p = data[1]
 	h.m = 1 << h.p
-	h.sparse = data[2] == 1
-
-	if h.sparse {
-		h.reg = nil
-
-		if len(data) > int(h.m)+3 {
-			return fmt.Errorf("expected buffer of max size %d, got %d", h.m+3, len(data))
+	h.hasher = defaultHasher
+	h.tmpSet = nil
+
+	if data[0] == 1 {
+		h.sparse = data[2] == 1
+		if h.sparse {
+			// Sparse payload is a flat sequence of big-endian uint32
+			// encodeHash codes, not the varint-delta format MarshalBinary
+			// writes today. Decode it back into raw codes and re-encode
+			// through the current pipeline so it dedupes and packs the
+			// same way freshly-inserted entries would.
+			h.reg = nil
+			h.overflow = nil
+			if (len(data)-3)%4 != 0 {
+				return fmt.Errorf("expected legacy sparse payload size to be a multiple of 4, got %d", len(data)-3)
+			}
+			tmp := make([]uint32, 0, (len(data)-3)/4)
+			for i := 3; i+4 <= len(data); i += 4 {
+				tmp = append(tmp, binary.BigEndian.Uint32(data[i:i+4]))
+			}
+			h.sparseList = h.encodeSorted(tmp)
+			return nil
 		}
 
-		h.sparseSet = make(compactSet, 0, h.m/4)
-		for i := 3; i+4 <= len(data); i += 4 {
-			h.sparseSet = append(h.sparseSet, binary.BigEndian.Uint32(data[i:i+4]))
+		// No mode header: dense payload is one byte per register. Unpack
+		// it into whatever RegisterMode this target sketch already uses.
+		h.sparseList = nil
+		if len(data) < int(h.m)+3 {
+			return fmt.Errorf("expected buffer of size %d, got %d", h.m+3, len(data))
 		}
 
+		h.reg = make([]uint8, regSize(h.m, h.mode))
+		h.overflow = nil
+		for i := uint32(0); i < h.m; i++ {
+			h.setRegMax(i, data[3+i])
+		}
 		return nil
 	}
 
-	h.sparseSet = nil
-	if len(data) < int(h.m)+3 {
-		return fmt.Errorf("expected buffer of size %d, got %d", h.m+3, len(data))
-	}
-
-	h.reg = make([]uint8, h.m)
-	copy(h.reg, data[3:])
-	return nil
+	return h.decodePayload(data[2], data[3:])
 }
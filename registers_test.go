@@ -0,0 +1,131 @@
+package hyperloglog
+
+import "testing"
+
+// TestPackedRegisterRoundTrip exercises Add/Count/MarshalBinary/
+// UnmarshalBinary/Merge for each packed RegisterMode, forcing the sketch
+// well past the sparse->dense conversion threshold so the packed bit
+// layout is actually under test.
+func TestPackedRegisterRoundTrip(t *testing.T) {
+	for _, mode := range []RegisterMode{RegisterPacked4, RegisterPacked6} {
+		h, err := NewPlusPacked(10, mode)
+		if err != nil {
+			t.Fatalf("mode=%d: NewPlusPacked: %v", mode, err)
+		}
+		addRange(h, "x", 20000)
+		if h.sparse {
+			t.Fatalf("mode=%d: test setup: sketch still sparse after 20000 adds", mode)
+		}
+		want := h.Count()
+
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("mode=%d: MarshalBinary: %v", mode, err)
+		}
+
+		got, err := NewPlusPacked(10, mode)
+		if err != nil {
+			t.Fatalf("mode=%d: NewPlusPacked: %v", mode, err)
+		}
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("mode=%d: UnmarshalBinary: %v", mode, err)
+		}
+		if got.Count() != want {
+			t.Errorf("mode=%d: Count() after round trip = %d, want %d", mode, got.Count(), want)
+		}
+
+		other, _ := NewPlusPacked(10, mode)
+		addRange(other, "y", 20000)
+		if err := h.Merge(other); err != nil {
+			t.Fatalf("mode=%d: Merge: %v", mode, err)
+		}
+		if h.Count() < want {
+			t.Errorf("mode=%d: Count() after Merge = %d, want >= %d", mode, h.Count(), want)
+		}
+	}
+}
+
+// TestPackedRegisterOverflow exercises the RegisterPacked4 overflow side
+// table: the in-band 4-bit field tops out at 14, 15 is the sentinel that
+// means "look in h.overflow", and setRegMax must keep routing an already-
+// overflowed register through the side table (including refusing to lower
+// it) rather than falling back to the truncated in-band value.
+func TestPackedRegisterOverflow(t *testing.T) {
+	h, _ := NewPlusPacked(4, RegisterPacked4)
+	h.toNormal()
+
+	h.setRegMax(0, 14)
+	if got := h.getReg(0); got != 14 {
+		t.Fatalf("getReg(0) = %d, want 14", got)
+	}
+	if h.overflow != nil {
+		t.Fatalf("overflow table populated for in-range value 14")
+	}
+
+	h.setRegMax(0, 15)
+	if got := h.getReg(0); got != 15 {
+		t.Fatalf("getReg(0) = %d, want 15 (from overflow table)", got)
+	}
+	if h.overflow[0] != 15 {
+		t.Fatalf("overflow[0] = %d, want 15", h.overflow[0])
+	}
+
+	h.setRegMax(0, 200)
+	if got := h.getReg(0); got != 200 {
+		t.Fatalf("getReg(0) = %d, want 200 after raising an overflowed register", got)
+	}
+
+	h.setRegMax(0, 50)
+	if got := h.getReg(0); got != 200 {
+		t.Fatalf("getReg(0) = %d, want 200 (setRegMax must not lower an overflowed register)", got)
+	}
+}
+
+// TestPackedRegisterLastIndexInBounds targets register m-1, the one
+// getBits/setBits's 16-bit read/write window is most likely to walk off
+// the end of the regSize-padded buffer for.
+func TestPackedRegisterLastIndexInBounds(t *testing.T) {
+	for _, mode := range []RegisterMode{RegisterPacked4, RegisterPacked6} {
+		h, _ := NewPlusPacked(4, mode)
+		h.toNormal()
+
+		last := h.m - 1
+		h.setRegMax(last, 10)
+		if got := h.getReg(last); got != 10 {
+			t.Errorf("mode=%d: getReg(m-1) = %d, want 10", mode, got)
+		}
+
+		// A neighboring register must be untouched by the last register's
+		// write.
+		if got := h.getReg(last - 1); got != 0 {
+			t.Errorf("mode=%d: getReg(m-2) = %d after writing m-1, want 0", mode, got)
+		}
+	}
+}
+
+// TestUnmarshalLegacyIntoPackedTarget decodes a pre-streaming binaryVersion
+// 1 dense blob -- one byte per register, no mode header -- into a sketch
+// configured for RegisterPacked4, including a register value (15) that
+// must land in the overflow side table rather than the in-band field.
+func TestUnmarshalLegacyIntoPackedTarget(t *testing.T) {
+	p := uint8(4)
+	m := uint32(1) << p
+	data := make([]byte, 3+m)
+	data[0] = 1
+	data[1] = p
+	data[2] = 0 // dense
+	for i := uint32(0); i < m; i++ {
+		data[3+i] = uint8(i % 16)
+	}
+
+	h, _ := NewPlusPacked(p, RegisterPacked4)
+	if err := h.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	for i := uint32(0); i < m; i++ {
+		want := uint8(i % 16)
+		if got := h.getReg(i); got != want {
+			t.Errorf("getReg(%d) = %d, want %d", i, got, want)
+		}
+	}
+}
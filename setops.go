@@ -0,0 +1,122 @@
+package hyperloglog
+
+import "errors"
+
+// Clone returns a deep copy of h, including its dense or sparse register
+// storage, so callers can use it as scratch space (e.g. for union/
+// intersection estimates) without mutating h.
+func (h *HyperLogLogPlus) Clone() *HyperLogLogPlus {
+	clone := &HyperLogLogPlus{
+		p:      h.p,
+		m:      h.m,
+		mode:   h.mode,
+		sparse: h.sparse,
+		hasher: h.hasher,
+	}
+
+	if h.reg != nil {
+		clone.reg = append([]uint8(nil), h.reg...)
+	}
+	if h.sparseList != nil {
+		clone.sparseList = append(sparseList(nil), h.sparseList...)
+	}
+	if h.tmpSet != nil {
+		clone.tmpSet = append([]uint32(nil), h.tmpSet...)
+	}
+	if h.overflow != nil {
+		clone.overflow = make(map[uint32]uint8, len(h.overflow))
+		for k, v := range h.overflow {
+			clone.overflow[k] = v
+		}
+	}
+	return clone
+}
+
+// unionCount estimates the cardinality of the union of sketches by cloning
+// the first and merging the rest into the clone.
+func unionCount(sketches []*HyperLogLogPlus) (uint64, error) {
+	if len(sketches) == 0 {
+		return 0, nil
+	}
+
+	union := sketches[0].Clone()
+	for _, s := range sketches[1:] {
+		if err := union.Merge(s); err != nil {
+			return 0, err
+		}
+	}
+	return union.Count(), nil
+}
+
+// IntersectCount estimates |sketches[0] ∩ sketches[1] ∩ ...| via
+// inclusion-exclusion over the unions of all non-empty subsets:
+//
+//	|⋂ S| = Σ (-1)^(|T|+1) * |⋃ T|   over every non-empty subset T of S
+//
+// This is the standard way to estimate an intersection from HLL sketches,
+// since HLL has no native intersection operator. Be aware that error
+// compounds badly when the true intersection is much smaller than the
+// union: every term is itself an estimate, the terms are summed with
+// alternating sign, and their errors don't cancel.
+func IntersectCount(sketches ...*HyperLogLogPlus) (uint64, error) {
+	if len(sketches) == 0 {
+		return 0, errors.New("at least one sketch is required")
+	}
+	for _, s := range sketches[1:] {
+		if s.p != sketches[0].p {
+			return 0, errors.New("precisions must be equal")
+		}
+	}
+
+	n := len(sketches)
+	var est float64
+	for subset := 1; subset < 1<<uint(n); subset++ {
+		var members []*HyperLogLogPlus
+		for i := 0; i < n; i++ {
+			if subset&(1<<uint(i)) != 0 {
+				members = append(members, sketches[i])
+			}
+		}
+
+		union, err := unionCount(members)
+		if err != nil {
+			return 0, err
+		}
+
+		sign := -1.0
+		if len(members)%2 == 1 {
+			sign = 1.0
+		}
+		est += sign * float64(union)
+	}
+
+	if est < 0 {
+		est = 0
+	}
+	return uint64(est), nil
+}
+
+// Jaccard estimates the Jaccard similarity |A ∩ B| / |A ∪ B| of a and b.
+func Jaccard(a, b *HyperLogLogPlus) (float64, error) {
+	if a.p != b.p {
+		return 0, errors.New("precisions must be equal")
+	}
+
+	union, err := unionCount([]*HyperLogLogPlus{a, b})
+	if err != nil {
+		return 0, err
+	}
+	if union == 0 {
+		return 0, nil
+	}
+
+	// |A ∩ B| = |A| + |B| - |A ∪ B|, the two-sketch case of IntersectCount's
+	// inclusion-exclusion identity, computed directly so the union above
+	// isn't estimated a second time inside a subset loop.
+	intersect := float64(a.Count()) + float64(b.Count()) - float64(union)
+	if intersect < 0 {
+		intersect = 0
+	}
+
+	return intersect / float64(union), nil
+}
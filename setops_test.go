@@ -0,0 +1,143 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// addRange adds count distinct keys, all prefixed with prefix so that ranges
+// with different prefixes are guaranteed disjoint, to h. Every test in this
+// file builds its sketches this way, so their IntersectCount/Jaccard
+// estimates depend on defaultHasher's avalanche finalization to keep the
+// register indices for these shared-prefix, sequential keys well
+// distributed.
+func addRange(h *HyperLogLogPlus, prefix string, count int) {
+	for i := 0; i < count; i++ {
+		h.AddBytes([]byte(fmt.Sprintf("%s-%d", prefix, i)))
+	}
+}
+
+// hllStdErr is HyperLogLog's standard relative error, 1.04/sqrt(m).
+func hllStdErr(p uint8) float64 {
+	return 1.04 / math.Sqrt(float64(uint32(1)<<p))
+}
+
+func TestIntersectCountTwoSketches(t *testing.T) {
+	// A and B each have 60000 elements, of which 30000 are shared, so
+	// |A ∩ B| = 30000 and |A ∪ B| = 90000. Keeping the intersection a
+	// sizeable fraction of the union avoids the error-amplification case
+	// IntersectCount's own doc comment warns about.
+	const onlyA, onlyB, both = 30000, 30000, 30000
+
+	for _, p := range []uint8{10, 12, 14} {
+		a, _ := NewPlus(p)
+		b, _ := NewPlus(p)
+		addRange(a, "a", onlyA)
+		addRange(a, "shared", both)
+		addRange(b, "b", onlyB)
+		addRange(b, "shared", both)
+
+		got, err := IntersectCount(a, b)
+		if err != nil {
+			t.Fatalf("p=%d: IntersectCount: %v", p, err)
+		}
+
+		// IntersectCount sums three HLL estimates (|A|, |B|, |A ∪ B|), so
+		// its error is a few multiples of a single sketch's standard error.
+		tol := 6 * hllStdErr(p) * float64(onlyA+onlyB+both)
+		if diff := math.Abs(float64(got) - both); diff > tol {
+			t.Errorf("p=%d: IntersectCount(a, b) = %d, want %d +/- %.0f", p, got, both, tol)
+		}
+	}
+}
+
+func TestIntersectCountThreeSketches(t *testing.T) {
+	const each, shared = 20000, 8000
+	p := uint8(14)
+
+	a, _ := NewPlus(p)
+	b, _ := NewPlus(p)
+	c, _ := NewPlus(p)
+	for _, h := range []*HyperLogLogPlus{a, b, c} {
+		addRange(h, "shared", shared)
+	}
+	addRange(a, "a", each)
+	addRange(b, "b", each)
+	addRange(c, "c", each)
+
+	got, err := IntersectCount(a, b, c)
+	if err != nil {
+		t.Fatalf("IntersectCount: %v", err)
+	}
+
+	tol := 10 * hllStdErr(p) * float64(3*each+shared)
+	if diff := math.Abs(float64(got) - shared); diff > tol {
+		t.Errorf("IntersectCount(a, b, c) = %d, want %d +/- %.0f", got, shared, tol)
+	}
+}
+
+func TestIntersectCountDisjoint(t *testing.T) {
+	p := uint8(14)
+	a, _ := NewPlus(p)
+	b, _ := NewPlus(p)
+	addRange(a, "a", 10000)
+	addRange(b, "b", 10000)
+
+	got, err := IntersectCount(a, b)
+	if err != nil {
+		t.Fatalf("IntersectCount: %v", err)
+	}
+	if tol := 6 * hllStdErr(p) * 20000; float64(got) > tol {
+		t.Errorf("IntersectCount(disjoint) = %d, want ~0 (+/- %.0f)", got, tol)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	const onlyA, onlyB, both = 30000, 30000, 30000
+	want := float64(both) / float64(onlyA+onlyB+both)
+
+	for _, p := range []uint8{10, 14} {
+		a, _ := NewPlus(p)
+		b, _ := NewPlus(p)
+		addRange(a, "a", onlyA)
+		addRange(a, "shared", both)
+		addRange(b, "b", onlyB)
+		addRange(b, "shared", both)
+
+		got, err := Jaccard(a, b)
+		if err != nil {
+			t.Fatalf("p=%d: Jaccard: %v", p, err)
+		}
+		if diff := math.Abs(got - want); diff > 0.1 {
+			t.Errorf("p=%d: Jaccard(a, b) = %.4f, want %.4f +/- 0.1", p, got, want)
+		}
+	}
+}
+
+func TestIntersectCountAndJaccardRequireMatchingPrecision(t *testing.T) {
+	a, _ := NewPlus(10)
+	b, _ := NewPlus(12)
+
+	if _, err := IntersectCount(a, b); err == nil {
+		t.Error("IntersectCount: expected error for mismatched precisions")
+	}
+	if _, err := Jaccard(a, b); err == nil {
+		t.Error("Jaccard: expected error for mismatched precisions")
+	}
+}
+
+func TestClone(t *testing.T) {
+	h, _ := NewPlus(10)
+	addRange(h, "x", 100)
+
+	clone := h.Clone()
+	addRange(h, "y", 10000)
+
+	if got, want := clone.Count(), uint64(100); math.Abs(float64(got)-float64(want)) > float64(want) {
+		t.Errorf("Clone diverged from source at clone time: Count() = %d, want ~%d", got, want)
+	}
+	if clone.Count() == h.Count() {
+		t.Errorf("Clone shares state with its source: clone=%d source=%d", clone.Count(), h.Count())
+	}
+}
@@ -0,0 +1,144 @@
+package hyperloglog
+
+import "testing"
+
+// TestEncodeSortedKeepsMaxRho checks that encodeSorted, when two tmpSet
+// entries share the same p'-bit sparseKey, keeps the one with the larger
+// rho regardless of input order -- the bug fixed in 8d2c960 resolved the
+// dedupe key at the coarser p-bit getIndex resolution instead, silently
+// dropping distinct high-rho entries that shared a p-bit index.
+func TestEncodeSortedKeepsMaxRho(t *testing.T) {
+	h, _ := NewPlus(14)
+
+	// idx spans the full p'-bit sparseKey range (pPrime=25 bits) so it
+	// behaves like a real encodeHash output, not a small sequential number
+	// that would only occupy a few of the low bits of the packed code.
+	const idx = uint32(1)<<24 + 12345
+	lo := idx<<7 | 3<<1 | 1
+	hi := idx<<7 | 9<<1 | 1
+	_, wantR := h.decodeHash(hi)
+
+	for _, in := range [][2]uint32{{lo, hi}, {hi, lo}} {
+		list := h.encodeSorted([]uint32{in[0], in[1]})
+		if n := list.count(); n != 1 {
+			t.Fatalf("encodeSorted(%v) produced %d entries, want 1 (same sparseKey)", in, n)
+		}
+
+		k, ok := list.iterator().next()
+		if !ok {
+			t.Fatal("encodeSorted produced no entries")
+		}
+		if gotKey := sparseKey(k); gotKey != idx {
+			t.Errorf("sparseKey(kept entry) = %d, want %d", gotKey, idx)
+		}
+		if _, r := h.decodeHash(k); r != wantR {
+			t.Errorf("encodeSorted(%v) kept rho %d, want %d (the max of the two)", in, r, wantR)
+		}
+	}
+}
+
+// TestTmpSetFlushesAtThreshold checks that tmpSet accumulates additions
+// without touching sparseList until it reaches maxTmpSet, at which point
+// mergeSparse drains it in the same Add call.
+func TestTmpSetFlushesAtThreshold(t *testing.T) {
+	h, _ := NewPlus(10)
+	max := h.maxTmpSet()
+	addRange(h, "pre", max-1)
+	if len(h.tmpSet) != max-1 {
+		t.Fatalf("tmpSet has %d entries before threshold, want %d", len(h.tmpSet), max-1)
+	}
+	if h.sparseList != nil {
+		t.Fatalf("sparseList populated before tmpSet reached its threshold")
+	}
+
+	addRange(h, "threshold", 1)
+	if len(h.tmpSet) != 0 {
+		t.Errorf("tmpSet not flushed at threshold: len = %d, want 0", len(h.tmpSet))
+	}
+	if h.sparseList == nil {
+		t.Errorf("sparseList not populated after tmpSet flush")
+	}
+}
+
+// TestMergeSparseListsKeepsMaxRhoAcrossBothLists checks mergeSparseLists'
+// linear merge: an index present in both lists keeps the larger rho, and
+// an index present in only one list passes through untouched.
+func TestMergeSparseListsKeepsMaxRhoAcrossBothLists(t *testing.T) {
+	h, _ := NewPlus(14)
+
+	// Both sparseKeys span the full p'-bit range, and are far enough apart
+	// that they can't collide once truncated to anything coarser.
+	idxShared := uint32(1)<<24 + 10
+	idxOnlyB := uint32(1)<<23 + 99
+
+	sharedLo := idxShared<<7 | 2<<1 | 1
+	sharedHi := idxShared<<7 | 7<<1 | 1
+	onlyB := idxOnlyB<<7 | 1<<1 | 1
+	_, wantSharedR := h.decodeHash(sharedHi)
+
+	a := h.encodeSorted([]uint32{sharedLo})
+	b := h.encodeSorted([]uint32{onlyB, sharedHi})
+
+	merged := h.mergeSparseLists(a, b)
+	if n := merged.count(); n != 2 {
+		t.Fatalf("mergeSparseLists produced %d entries, want 2", n)
+	}
+
+	seen := map[uint32]uint8{}
+	it := merged.iterator()
+	for {
+		k, ok := it.next()
+		if !ok {
+			break
+		}
+		_, r := h.decodeHash(k)
+		seen[sparseKey(k)] = r
+	}
+
+	if r, ok := seen[idxShared]; !ok || r != wantSharedR {
+		t.Errorf("merged rho for shared sparseKey = %d (present=%v), want %d (max across both lists)", r, ok, wantSharedR)
+	}
+	if _, ok := seen[idxOnlyB]; !ok {
+		t.Errorf("sparseKey present only in b is missing from the merged list")
+	}
+}
+
+// TestToNormalPreservesSparseRegisters checks that toNormal, which replays
+// every sparseList entry through addHash/setRegMax, ends up with exactly
+// the same per-register maximum rho the sparse representation held, and
+// leaves every other register at zero.
+func TestToNormalPreservesSparseRegisters(t *testing.T) {
+	h, _ := NewPlus(14)
+	addRange(h, "z", 200)
+	if !h.sparse {
+		t.Fatal("test setup: sketch already converted to normal")
+	}
+
+	h.mergeSparse()
+	want := map[uint32]uint8{}
+	it := h.sparseList.iterator()
+	for {
+		k, ok := it.next()
+		if !ok {
+			break
+		}
+		idx, r := h.decodeHash(k)
+		if r > want[idx] {
+			want[idx] = r
+		}
+	}
+
+	h.toNormal()
+	for idx, r := range want {
+		if got := h.getReg(idx); got != r {
+			t.Errorf("getReg(%d) = %d after toNormal, want %d", idx, got, r)
+		}
+	}
+	for i := uint32(0); i < h.m; i++ {
+		if _, ok := want[i]; !ok {
+			if got := h.getReg(i); got != 0 {
+				t.Errorf("getReg(%d) = %d, want 0 (register untouched by sparse list)", i, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var streamMagic = [4]byte{'H', 'L', 'P', '1'}
+
+// streamHeaderSize is the magic (4) + format version (1) + precision (1) +
+// flags (1) + payload length (4).
+const (
+	streamFormatVersion = 1
+	streamHeaderSize    = 4 + 1 + 1 + 1 + 4
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WriteTo implements io.WriterTo. It writes h as a single self-describing
+// framed record -- magic, format version, precision, a flags byte (sparse
+// bit and RegisterMode), a length-prefixed payload, and a trailing CRC32C
+// of the payload -- so sketches can be appended to a log or socket and read
+// back one at a time without a full re-marshal. ReadPlusFrom reverses this
+// and can be called in a loop on a Reader to stream many records back.
+func (h *HyperLogLogPlus) WriteTo(w io.Writer) (int64, error) {
+	if h.sparse {
+		h.mergeSparse()
+	}
+	payload := h.encodePayload()
+
+	header := make([]byte, streamHeaderSize)
+	copy(header[:4], streamMagic[:])
+	header[4] = streamFormatVersion
+	header[5] = h.p
+	header[6] = h.encodeFlags()
+	binary.BigEndian.PutUint32(header[7:11], uint32(len(payload)))
+
+	var total int64
+
+	n, err := w.Write(header)
+	total += int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	n, err = w.Write(payload)
+	total += int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	var trailer [4]byte
+	binary.BigEndian.PutUint32(trailer[:], crc32.Checksum(payload, crc32cTable))
+	n, err = w.Write(trailer[:])
+	total += int64(n)
+	return total, err
+}
+
+// maxPayloadSize returns a generous upper bound on the payload a valid
+// record at precision and flags could contain, so ReadPlusFrom can reject a
+// corrupt or truncated length prefix before allocating it.
+func maxPayloadSize(precision, flags byte) uint32 {
+	m := uint32(1) << precision
+	if flags&flagSparse != 0 {
+		// Varint-delta entries cost at most MaxVarintLen32 bytes each;
+		// maybeToNormal converts to dense well before the list could grow
+		// this large.
+		return m * uint32(binary.MaxVarintLen32)
+	}
+
+	size := uint32(regSize(m, RegisterMode((flags&flagModeMask)>>flagModeShift)))
+	size += 4 + m*5 // room for the RegisterPacked4 overflow table, if present
+	return size
+}
+
+// ReadPlusFrom reads one record written by WriteTo and returns the decoded
+// HyperLogLogPlus. Call it repeatedly on a Reader positioned at the start
+// of a concatenated sequence of records to stream them all back.
+func ReadPlusFrom(r io.Reader) (*HyperLogLogPlus, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], streamMagic[:]) {
+		return nil, errors.New("hyperloglog: bad magic in stream record header")
+	}
+	if header[4] != streamFormatVersion {
+		return nil, fmt.Errorf("hyperloglog: unknown stream format version %d", header[4])
+	}
+
+	precision := header[5]
+	flags := header[6]
+	payloadLen := binary.BigEndian.Uint32(header[7:11])
+
+	if precision > 18 || precision < 4 {
+		return nil, fmt.Errorf("hyperloglog: invalid precision %d in stream record header", precision)
+	}
+	if max := maxPayloadSize(precision, flags); payloadLen > max {
+		return nil, fmt.Errorf("hyperloglog: stream record payload length %d exceeds %d byte bound for precision %d", payloadLen, max, precision)
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	var trailer [4]byte
+	if _, err := io.ReadFull(r, trailer[:]); err != nil {
+		return nil, err
+	}
+	if want, got := binary.BigEndian.Uint32(trailer[:]), crc32.Checksum(payload, crc32cTable); want != got {
+		return nil, errors.New("hyperloglog: stream record failed CRC32C check")
+	}
+
+	h, err := createPlus(precision)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.decodePayload(flags, payload); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,120 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// TestStreamingRoundTrip round-trips a sketch through WriteTo/ReadPlusFrom
+// for every RegisterMode, forcing each one past the sparse->dense
+// conversion threshold so the dense payload path is exercised too.
+func TestStreamingRoundTrip(t *testing.T) {
+	for _, mode := range []RegisterMode{RegisterDense, RegisterPacked6, RegisterPacked4} {
+		h, _ := NewPlusPacked(10, mode)
+		addRange(h, "s", 20000)
+
+		var buf bytes.Buffer
+		if _, err := h.WriteTo(&buf); err != nil {
+			t.Fatalf("mode=%d: WriteTo: %v", mode, err)
+		}
+
+		got, err := ReadPlusFrom(&buf)
+		if err != nil {
+			t.Fatalf("mode=%d: ReadPlusFrom: %v", mode, err)
+		}
+		if got.Count() != h.Count() {
+			t.Errorf("mode=%d: round trip Count() = %d, want %d", mode, got.Count(), h.Count())
+		}
+	}
+}
+
+// TestStreamingRoundTripSparse covers the sparse payload path, which
+// WriteTo/ReadPlusFrom handle separately from the dense one.
+func TestStreamingRoundTripSparse(t *testing.T) {
+	h, _ := NewPlus(14)
+	addRange(h, "s", 50)
+
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	got, err := ReadPlusFrom(&buf)
+	if err != nil {
+		t.Fatalf("ReadPlusFrom: %v", err)
+	}
+	if got.Count() != h.Count() {
+		t.Errorf("round trip Count() = %d, want %d", got.Count(), h.Count())
+	}
+}
+
+// TestReadPlusFromRejectsCorruptedPayload checks that the trailing CRC32C
+// actually catches a flipped bit in the payload instead of silently
+// decoding a corrupted sketch.
+func TestReadPlusFromRejectsCorruptedPayload(t *testing.T) {
+	h, _ := NewPlus(10)
+	addRange(h, "s", 20000)
+
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	data := buf.Bytes()
+	data[streamHeaderSize] ^= 0xff
+
+	if _, err := ReadPlusFrom(bytes.NewReader(data)); err == nil {
+		t.Error("ReadPlusFrom accepted a record with a corrupted payload")
+	}
+}
+
+// TestReadPlusFromRejectsOversizedLengthPrefix is a regression test for the
+// DoS a175685 fixed: a corrupt or adversarial length prefix must be
+// rejected against maxPayloadSize before ReadPlusFrom allocates a buffer
+// for it, not after.
+func TestReadPlusFromRejectsOversizedLengthPrefix(t *testing.T) {
+	h, _ := NewPlus(10)
+	addRange(h, "s", 10)
+
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[7:11], 0xfffffffe)
+
+	if _, err := ReadPlusFrom(bytes.NewReader(data)); err == nil {
+		t.Fatal("ReadPlusFrom accepted an oversized length prefix")
+	}
+}
+
+// TestReadPlusFromReadsConcatenatedRecords exercises the headline use case
+// in WriteTo's doc comment: calling ReadPlusFrom in a loop over a stream of
+// back-to-back records.
+func TestReadPlusFromReadsConcatenatedRecords(t *testing.T) {
+	const n = 5
+	var buf bytes.Buffer
+	var counts [n]uint64
+
+	for i := 0; i < n; i++ {
+		h, _ := NewPlus(10)
+		addRange(h, fmt.Sprintf("rec-%d", i), 100*(i+1))
+		counts[i] = h.Count()
+		if _, err := h.WriteTo(&buf); err != nil {
+			t.Fatalf("record %d: WriteTo: %v", i, err)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		got, err := ReadPlusFrom(&buf)
+		if err != nil {
+			t.Fatalf("record %d: ReadPlusFrom: %v", i, err)
+		}
+		if got.Count() != counts[i] {
+			t.Errorf("record %d: Count() = %d, want %d", i, got.Count(), counts[i])
+		}
+	}
+	if _, err := ReadPlusFrom(&buf); err == nil {
+		t.Error("ReadPlusFrom succeeded past the last record")
+	}
+}